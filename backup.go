@@ -0,0 +1,211 @@
+package portableapps
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultBackupMaxCount is the number of snapshots ImportRegKey keeps
+// automatically via PruneRegBackups.
+const defaultBackupMaxCount = 5
+
+// RegBackupPolicy bounds how many `<Base>.<timestamp>` snapshots
+// PruneRegBackups keeps in Dir.
+type RegBackupPolicy struct {
+	// Dir is the directory snapshots live in.
+	Dir string
+	// Base is the backed-up file's name; snapshots are named "Base.<ts>".
+	Base string
+	// MaxCount is how many snapshots to keep, newest first. Zero means
+	// unbounded.
+	MaxCount int
+	// MaxAge discards snapshots older than this regardless of MaxCount.
+	// Zero means unbounded.
+	MaxAge time.Duration
+}
+
+// PruneRegBackups removes snapshots under policy.Dir named after
+// policy.Base that fall outside policy.MaxCount or policy.MaxAge.
+func PruneRegBackups(policy RegBackupPolicy) error {
+	entries, err := ioutil.ReadDir(policy.Dir)
+	if err != nil {
+		return fmt.Errorf("read backup dir %s: %w", policy.Dir, err)
+	}
+
+	prefix := policy.Base + "."
+
+	type backup struct {
+		path string
+		ts   time.Time
+	}
+
+	var backups []backup
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		ts, err := time.ParseInLocation("20060102150405", strings.TrimPrefix(entry.Name(), prefix), time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(policy.Dir, entry.Name()), ts: ts})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ts.After(backups[j].ts) })
+
+	now := time.Now()
+	for i, b := range backups {
+		expired := policy.MaxAge > 0 && now.Sub(b.ts) > policy.MaxAge
+		overflow := policy.MaxCount > 0 && i >= policy.MaxCount
+		if !expired && !overflow {
+			continue
+		}
+		if err := os.RemoveAll(b.path); err != nil {
+			return fmt.Errorf("remove backup %s: %w", b.path, err)
+		}
+	}
+
+	return nil
+}
+
+// RegDiffChange classifies how a registry value changed between two
+// snapshots.
+type RegDiffChange string
+
+// Kinds of change a RegDiffEntry can describe.
+const (
+	RegDiffAdded    RegDiffChange = "added"
+	RegDiffRemoved  RegDiffChange = "removed"
+	RegDiffModified RegDiffChange = "modified"
+)
+
+// RegDiffEntry describes one value that differs between two .reg exports.
+type RegDiffEntry struct {
+	Key      string
+	Name     string
+	OldValue string
+	NewValue string
+	Change   RegDiffChange
+}
+
+// DiffRegKey parses two .reg exports and returns the values that were
+// added, removed or modified between a and b, so a launcher can log what a
+// session actually changed (or decide whether to roll back to a pre-launch
+// snapshot).
+func DiffRegKey(a, b string) ([]RegDiffEntry, error) {
+	before, err := parseRegFile(a)
+	if err != nil {
+		return nil, err
+	}
+	after, err := parseRegFile(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var diff []RegDiffEntry
+	for _, key := range sortedUnionKeys(before, after) {
+		beforeValues := before[key]
+		afterValues := after[key]
+
+		for _, name := range sortedUnionNames(beforeValues, afterValues) {
+			oldValue, hadOld := beforeValues[name]
+			newValue, hasNew := afterValues[name]
+
+			switch {
+			case !hadOld && hasNew:
+				diff = append(diff, RegDiffEntry{Key: key, Name: name, NewValue: newValue, Change: RegDiffAdded})
+			case hadOld && !hasNew:
+				diff = append(diff, RegDiffEntry{Key: key, Name: name, OldValue: oldValue, Change: RegDiffRemoved})
+			case oldValue != newValue:
+				diff = append(diff, RegDiffEntry{Key: key, Name: name, OldValue: oldValue, NewValue: newValue, Change: RegDiffModified})
+			}
+		}
+	}
+
+	return diff, nil
+}
+
+// parseRegFile reads a .reg export into key -> value name -> raw value.
+func parseRegFile(path string) (map[string]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	values := map[string]map[string]string{}
+	section := ""
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "", strings.HasPrefix(line, ";"), strings.HasPrefix(line, "Windows Registry Editor"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.Trim(line, "[]")
+			if values[section] == nil {
+				values[section] = map[string]string{}
+			}
+			continue
+		}
+
+		if section == "" {
+			continue
+		}
+
+		idx := strings.Index(line, "=")
+		if idx < 0 {
+			continue
+		}
+
+		name := strings.Trim(line[:idx], `"`)
+		values[section][name] = line[idx+1:]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+func sortedUnionKeys(a, b map[string]map[string]string) []string {
+	seen := map[string]bool{}
+	for k := range a {
+		seen[k] = true
+	}
+	for k := range b {
+		seen[k] = true
+	}
+
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedUnionNames(a, b map[string]string) []string {
+	seen := map[string]bool{}
+	for n := range a {
+		seen[n] = true
+	}
+	for n := range b {
+		seen[n] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for n := range seen {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
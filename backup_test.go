@@ -0,0 +1,145 @@
+package portableapps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeBackup(t *testing.T, dir, base, timestamp string) {
+	t.Helper()
+	path := filepath.Join(dir, base+"."+timestamp)
+	if err := ioutil.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatalf("WriteFile(%s): %v", path, err)
+	}
+}
+
+func TestPruneRegBackupsMaxCount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "portapps-backups")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const base = "app.reg"
+	writeBackup(t, dir, base, "20200101000000")
+	writeBackup(t, dir, base, "20200102000000")
+	writeBackup(t, dir, base, "20200103000000")
+
+	if err := PruneRegBackups(RegBackupPolicy{Dir: dir, Base: base, MaxCount: 1}); err != nil {
+		t.Fatalf("PruneRegBackups: %v", err)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d backups, want 1", len(entries))
+	}
+	if want := base + ".20200103000000"; entries[0].Name() != want {
+		t.Errorf("kept backup %q, want newest %q", entries[0].Name(), want)
+	}
+}
+
+func TestPruneRegBackupsMaxAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "portapps-backups")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const base = "app.reg"
+	oldTS := time.Now().Add(-48 * time.Hour).Format("20060102150405")
+	recentTS := time.Now().Add(-1 * time.Hour).Format("20060102150405")
+	writeBackup(t, dir, base, oldTS)
+	writeBackup(t, dir, base, recentTS)
+
+	if err := PruneRegBackups(RegBackupPolicy{Dir: dir, Base: base, MaxAge: 24 * time.Hour}); err != nil {
+		t.Fatalf("PruneRegBackups: %v", err)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != base+"."+recentTS {
+		t.Fatalf("got %v, want only the recent backup", entries)
+	}
+}
+
+func TestParseRegFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "portapps-parse")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "export.reg")
+	content := "Windows Registry Editor Version 5.00\n\n" +
+		`[HKEY_CURRENT_USER\Software\App]` + "\n" +
+		`"Name"="Value"` + "\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	values, err := parseRegFile(path)
+	if err != nil {
+		t.Fatalf("parseRegFile: %v", err)
+	}
+
+	section := values[`HKEY_CURRENT_USER\Software\App`]
+	if section == nil || section["Name"] != `"Value"` {
+		t.Fatalf("parseRegFile() = %v", values)
+	}
+}
+
+func TestDiffRegKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "portapps-diff")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	before := filepath.Join(dir, "before.reg")
+	after := filepath.Join(dir, "after.reg")
+
+	section := `[HKEY_CURRENT_USER\Software\App]` + "\n"
+	beforeContent := "Windows Registry Editor Version 5.00\n\n" + section +
+		`"Kept"="same"` + "\n" + `"Removed"="gone"` + "\n" + `"Changed"="old"` + "\n"
+	afterContent := "Windows Registry Editor Version 5.00\n\n" + section +
+		`"Kept"="same"` + "\n" + `"Changed"="new"` + "\n" + `"Added"="here"` + "\n"
+
+	if err := ioutil.WriteFile(before, []byte(beforeContent), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := ioutil.WriteFile(after, []byte(afterContent), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	diff, err := DiffRegKey(before, after)
+	if err != nil {
+		t.Fatalf("DiffRegKey: %v", err)
+	}
+
+	changes := map[string]RegDiffChange{}
+	for _, entry := range diff {
+		changes[entry.Name] = entry.Change
+	}
+
+	want := map[string]RegDiffChange{
+		"Removed": RegDiffRemoved,
+		"Changed": RegDiffModified,
+		"Added":   RegDiffAdded,
+	}
+	for name, change := range want {
+		if changes[name] != change {
+			t.Errorf("change for %q = %q, want %q", name, changes[name], change)
+		}
+	}
+	if _, ok := changes["Kept"]; ok {
+		t.Errorf("unchanged value %q should not appear in the diff", "Kept")
+	}
+}
@@ -0,0 +1,59 @@
+package portableapps
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors returned by portableapps helpers. Use errors.Is to check
+// for a specific failure class regardless of how it was wrapped.
+var (
+	// ErrRegExport is returned when a state export or import fails.
+	ErrRegExport = errors.New("portableapps: state export/import failed")
+
+	// ErrProcessMissing is returned by Papp.FromFile when the manifest's
+	// process does not exist on disk.
+	ErrProcessMissing = errors.New("portableapps: process not found")
+
+	// ErrDataPath is returned by Init when Papp's path cannot be resolved or
+	// its log file cannot be opened.
+	ErrDataPath = errors.New("portableapps: data path error")
+
+	// ErrAlreadyRunning is returned by AcquireSingleInstance when another
+	// instance of the app already holds the lock.
+	ErrAlreadyRunning = errors.New("portableapps: another instance is already running")
+)
+
+// ExitError is returned by ExecCmd, and by Launch's child wait, when the
+// process ran but exited with a non-zero status. Use errors.As to recover
+// the exit code.
+type ExitError struct {
+	ExitCode uint32
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("process exited with code %d", e.ExitCode)
+}
+
+// Run centralizes logging and exit-code handling for a launcher's main().
+// setup should call Init, Launch and any other portableapps helpers and
+// return their first error. Run logs that error and returns the process
+// exit code to pass to os.Exit.
+func Run(setup func() error) int {
+	err := setup()
+	if err == nil {
+		return 0
+	}
+
+	if Log != nil {
+		Log.Errorf("%v", err)
+	} else {
+		fmt.Println(err)
+	}
+
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return int(exitErr.ExitCode)
+	}
+	return 1
+}
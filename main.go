@@ -2,10 +2,13 @@ package portableapps
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"syscall"
@@ -14,15 +17,22 @@ import (
 	"github.com/google/logger"
 )
 
+// defaultShutdownTimeout is used when Papp.ShutdownTimeout is unset.
+const defaultShutdownTimeout = 10 * time.Second
+
 type papp struct {
-	ID         string
-	Name       string
-	Path       string
-	AppPath    string
-	DataPath   string
-	Process    string
-	Args       []string
-	WorkingDir string
+	ID               string
+	Name             string
+	Path             string
+	AppPath          string
+	DataPath         string
+	Process          string
+	Args             []string
+	WorkingDir       string
+	RegsExportImport []RegExportImport
+	ShutdownTimeout  time.Duration
+	SingleInstance   bool
+	GlobalMutex      bool
 }
 
 // CmdOptions options of command
@@ -47,6 +57,15 @@ type RegExportImport struct {
 	File string
 }
 
+// StatePersister persists and restores an app's mutable state (a Windows
+// registry key, or the POSIX config directory it stands in for) so a
+// session's changes can be snapshotted and rolled back. Each platform file
+// registers its implementation in persister from an init func.
+type StatePersister interface {
+	Export(reg RegExportImport) error
+	Import(reg RegExportImport) error
+}
+
 var (
 	// Papp settings
 	Papp papp
@@ -56,28 +75,49 @@ var (
 
 	// Logfile is the log file used by logger
 	Logfile *os.File
+
+	// persister is the platform-specific StatePersister, set from an init
+	// func in the active portableapps_<os>.go file.
+	persister StatePersister
 )
 
 // Init must be used by every Portapp
-func Init() {
+func Init() error {
 	var err error
 
 	Papp.Path, err = filepath.Abs(filepath.Dir(os.Args[0]))
 	if err != nil {
-		Log.Fatal("Current path:", err)
+		return fmt.Errorf("%w: current path: %v", ErrDataPath, err)
+	}
+
+	// Load the manifest (if any) before anything below reads Papp.ID/Name,
+	// so a generic launcher driven purely by portapp.yml still gets a
+	// correctly named log file and startup banner. DataPath is resolved first
+	// so ${DataPath} tokens in the manifest expand to it.
+	Papp.DataPath = AppPathJoin("data")
+	manifestPath, manifestErr := locateManifest()
+	if manifestErr == nil {
+		if err := Papp.FromFile(manifestPath); err != nil {
+			return fmt.Errorf("load manifest: %w", err)
+		}
 	}
 
 	Papp.DataPath = AppPathJoin("data")
 
 	Logfile, err = os.OpenFile(PathJoin(Papp.Path, Papp.ID+".log"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
-		Log.Fatal("Log file:", err)
+		return fmt.Errorf("%w: log file: %v", ErrDataPath, err)
 	}
 
 	Log = logger.Init(Papp.Name, false, false, Logfile)
 	Log.Info("--------")
 	Log.Infof("Starting %s...", Papp.Name)
 	Log.Infof("Current path: %s", Papp.Path)
+	if manifestErr == nil {
+		Log.Infof("Loaded manifest: %s", manifestPath)
+	}
+
+	return nil
 }
 
 // FindElectronAppFolder retrieved the app electron folder
@@ -96,63 +136,99 @@ func FindElectronAppFolder(prefix string, source string) string {
 }
 
 // OverrideEnv to override an env var
-func OverrideEnv(key string, value string) {
+func OverrideEnv(key string, value string) error {
 	if err := os.Setenv(key, value); err != nil {
-		Log.Fatalf("Cannot set %s env var: %v", key, err)
+		return fmt.Errorf("set %s env var: %w", key, err)
 	}
+	return nil
 }
 
-// ExportRegKey export a registry key
-func ExportRegKey(reg RegExportImport) {
-	cmdResult, err := ExecCmd(CmdOptions{
-		Command:    "reg",
-		Args:       []string{"export", reg.Key, reg.File, "/y", fmt.Sprintf("/reg:%s", reg.Arch)},
-		HideWindow: true,
-	})
-	if err != nil {
-		Log.Fatalf("Cannot export registry key '%s': %v", reg.Key, err)
-	}
-	if cmdResult.ExitCode != 0 {
-		Log.Errorf(fmt.Sprintf("%d", cmdResult.ExitCode))
-		if len(cmdResult.Stderr) > 0 {
-			Log.Errorf(fmt.Sprintf("%s\n", cmdResult.Stderr))
-		}
+// ExportRegKey persists the app's current state through the platform's
+// StatePersister (a registry export on Windows, a config directory dump on
+// POSIX).
+func ExportRegKey(reg RegExportImport) error {
+	if err := persister.Export(reg); err != nil {
+		return fmt.Errorf("%w: export '%s': %v", ErrRegExport, reg.Key, err)
 	}
+	return nil
 }
 
-// ImportRegKey import a registry key
-func ImportRegKey(reg RegExportImport) {
-	// Save current reg key
-	ExportRegKey(RegExportImport{
+// ImportRegKey restores a previously persisted app state, keeping a
+// timestamped backup of the current state beforehand and pruning older
+// backups down to defaultBackupMaxCount.
+func ImportRegKey(reg RegExportImport) error {
+	// Save current state. On a fresh install there is nothing to export yet
+	// (e.g. "reg export" on a key that doesn't exist), so this is logged and
+	// skipped rather than aborting the import.
+	if err := ExportRegKey(RegExportImport{
 		Key:  reg.Key,
 		Arch: reg.Arch,
 		File: fmt.Sprintf("%s.%s", reg.File, time.Now().Format("20060102150405")),
-	})
+	}); err != nil {
+		Log.Errorf("Cannot back up current state for '%s': %v", reg.Key, err)
+	}
 
-	// Check if reg file exists
-	if _, err := os.Stat(reg.File); err != nil {
-		return
+	if err := PruneRegBackups(RegBackupPolicy{
+		Dir:      filepath.Dir(reg.File),
+		Base:     filepath.Base(reg.File),
+		MaxCount: defaultBackupMaxCount,
+	}); err != nil {
+		Log.Errorf("Prune backups for '%s': %v", reg.Key, err)
 	}
 
-	// Import
-	cmdResult, err := ExecCmd(CmdOptions{
-		Command:    "reg",
-		Args:       []string{"import", reg.File, fmt.Sprintf("/reg:%s", reg.Arch)},
-		HideWindow: true,
-	})
-	if err != nil {
-		Log.Fatalf("Cannot import registry file '%s': %v", reg.File, err)
+	if err := persister.Import(reg); err != nil {
+		return fmt.Errorf("%w: import '%s': %v", ErrRegExport, reg.Key, err)
 	}
-	if cmdResult.ExitCode != 0 {
-		Log.Errorf(fmt.Sprintf("%d", cmdResult.ExitCode))
-		if len(cmdResult.Stderr) > 0 {
-			Log.Errorf(fmt.Sprintf("%s\n", cmdResult.Stderr))
+	return nil
+}
+
+// AcquireSingleInstance guards against more than one copy of the app
+// running at once, keyed off name (Papp.ID). On Windows this is a named
+// mutex under `Local\` or, when global is true, `Global\`; if another
+// instance already holds it, its window (matched by Papp.Name) is brought
+// to the foreground. On POSIX it falls back to an flock'ed file under
+// Papp.DataPath. When the lock is already held, release is nil and err is
+// ErrAlreadyRunning; otherwise the caller should defer release() once done.
+func AcquireSingleInstance(name string, global bool) (func(), error) {
+	return acquireSingleInstance(name, global)
+}
+
+// Launch executes the app, forwarding Ctrl+C/SIGTERM (and, on Windows, a
+// console close/shutdown event) to the child, then waiting up to
+// Papp.ShutdownTimeout (10s by default) for it to exit before killing it.
+// Launch returns once the child has exited, cancelling ctx has the same
+// effect as an incoming signal, and a non-zero child exit code is surfaced
+// as an error rather than being silently discarded. If Papp.SingleInstance
+// is set and another instance is already running, Launch foregrounds it (on
+// Windows) and returns nil without starting a second copy. Any entries in
+// Papp.RegsExportImport (hand-set or loaded from a manifest) are imported
+// before the child starts and exported again once it exits.
+func Launch(ctx context.Context) error {
+	if Papp.SingleInstance {
+		release, err := AcquireSingleInstance(Papp.ID, Papp.GlobalMutex)
+		if errors.Is(err, ErrAlreadyRunning) {
+			Log.Infof("%s is already running, exiting", Papp.Name)
+			return nil
 		}
+		if err != nil {
+			return fmt.Errorf("single instance: %w", err)
+		}
+		defer release()
 	}
-}
 
-// Launch to execute the app
-func Launch() {
+	for _, reg := range Papp.RegsExportImport {
+		if err := ImportRegKey(reg); err != nil {
+			return fmt.Errorf("import state '%s': %w", reg.Key, err)
+		}
+	}
+	defer func() {
+		for _, reg := range Papp.RegsExportImport {
+			if err := ExportRegKey(reg); err != nil {
+				Log.Errorf("Cannot export state '%s': %v", reg.Key, err)
+			}
+		}
+	}()
+
 	Log.Infof("Process: %s", Papp.Process)
 	Log.Infof("Args: %s", strings.Join(Papp.Args, " "))
 	Log.Infof("Working dir: %s", Papp.WorkingDir)
@@ -161,35 +237,92 @@ func Launch() {
 	Log.Infof("Launch %s...", Papp.Name)
 	execute := exec.Command(Papp.Process, Papp.Args...)
 	execute.Dir = Papp.WorkingDir
-
 	execute.Stdout = Logfile
 	execute.Stderr = Logfile
+	execute.SysProcAttr = sysProcAttr(false)
 
 	Log.Infof("Exec %s %s", Papp.Process, strings.Join(Papp.Args, " "))
 	if err := execute.Start(); err != nil {
-		Log.Fatalf("Command failed: %v", err)
+		return fmt.Errorf("launch %s: %w", Papp.Process, err)
 	}
 
-	execute.Wait()
+	done := make(chan error, 1)
+	go func() { done <- execute.Wait() }()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	extraCh, stopExtra := shutdownSignals()
+	defer stopExtra()
+
+	select {
+	case err := <-done:
+		return exitCodeErr(execute.ProcessState, err)
+	case <-ctx.Done():
+		return launchShutdown(execute, done, ctx.Err())
+	case sig := <-sigCh:
+		Log.Infof("Received %s, shutting down %s...", sig, Papp.Name)
+		return launchShutdown(execute, done, nil)
+	case <-extraCh:
+		Log.Infof("Received shutdown event, shutting down %s...", Papp.Name)
+		return launchShutdown(execute, done, nil)
+	}
 }
 
-// CreateFolder to create a folder and get its path
-func CreateFolder(path string) string {
-	Log.Infof("Create folder %s...", path)
-	if err := os.MkdirAll(path, 777); err != nil {
-		Log.Fatalf("Cannot create folder: %v", err)
+// launchShutdown signals the child to stop and waits up to
+// Papp.ShutdownTimeout before force-killing it. cause, if set, takes
+// precedence over the child's own exit status (e.g. a cancelled ctx).
+func launchShutdown(execute *exec.Cmd, done chan error, cause error) error {
+	timeout := Papp.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	if err := signalProcessGroup(execute.Process); err != nil {
+		Log.Errorf("Cannot signal %s: %v", Papp.Name, err)
+	}
+
+	select {
+	case err := <-done:
+		if cause != nil {
+			return cause
+		}
+		return exitCodeErr(execute.ProcessState, err)
+	case <-time.After(timeout):
+		Log.Infof("%s did not stop within %s, killing it", Papp.Name, timeout)
+		if err := killProcessGroup(execute.Process); err != nil {
+			Log.Errorf("Cannot kill %s: %v", Papp.Name, err)
+		}
+		<-done
+		if cause != nil {
+			return cause
+		}
+		return fmt.Errorf("%s killed after %s shutdown timeout", Papp.Name, timeout)
 	}
-	return path
 }
 
-// PathJoin to join paths
-func PathJoin(elem ...string) string {
-	for i, e := range elem {
-		if e != "" {
-			return strings.Join(elem[i:], `\`)
+// exitCodeErr turns a non-zero child exit code into an *ExitError, or
+// returns waitErr unchanged if the exit code can't be determined.
+func exitCodeErr(ps *os.ProcessState, waitErr error) error {
+	if waitErr == nil {
+		return nil
+	}
+	if ps != nil {
+		if code := exitCode(ps); code != 0 {
+			return fmt.Errorf("%s: %w", Papp.Name, &ExitError{ExitCode: code})
 		}
 	}
-	return ""
+	return waitErr
+}
+
+// CreateFolder to create a folder and get its path
+func CreateFolder(path string) (string, error) {
+	Log.Infof("Create folder %s...", path)
+	if err := os.MkdirAll(path, 777); err != nil {
+		return "", fmt.Errorf("create folder %s: %w", path, err)
+	}
+	return path, nil
 }
 
 // AppPathJoin to join paths from Papp.Path
@@ -206,7 +339,7 @@ func ExecCmd(options CmdOptions) (CmdResult, error) {
 	command.Stdout = commandStdout
 	commandStderr := &bytes.Buffer{}
 	command.Stderr = commandStderr
-	command.SysProcAttr = &syscall.SysProcAttr{HideWindow: options.HideWindow}
+	command.SysProcAttr = sysProcAttr(options.HideWindow)
 
 	if options.WorkingDir != "" {
 		command.Dir = options.WorkingDir
@@ -218,11 +351,13 @@ func ExecCmd(options CmdOptions) (CmdResult, error) {
 	}
 
 	command.Wait()
-	waitStatus := command.ProcessState.Sys().(syscall.WaitStatus)
 
-	result.ExitCode = waitStatus.ExitCode
+	result.ExitCode = exitCode(command.ProcessState)
 	result.Stdout = strings.TrimSpace(commandStdout.String())
 	result.Stderr = strings.TrimSpace(commandStderr.String())
 
+	if result.ExitCode != 0 {
+		return result, &ExitError{ExitCode: result.ExitCode}
+	}
 	return result, nil
 }
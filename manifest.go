@@ -0,0 +1,130 @@
+package portableapps
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// manifestFilenames are the manifest names looked up next to the executable,
+// in order of preference.
+var manifestFilenames = []string{"portapp.yml", "portapp.yaml", "portapp.json"}
+
+// manifest is the on-disk shape of a portapp.yml/portapp.json file.
+type manifest struct {
+	ID              string            `yaml:"id" json:"id"`
+	Name            string            `yaml:"name" json:"name"`
+	Process         string            `yaml:"process" json:"process"`
+	Args            []string          `yaml:"args" json:"args"`
+	WorkingDir      string            `yaml:"workingDir" json:"workingDir"`
+	RegExportImport []RegExportImport `yaml:"regExportImport" json:"regExportImport"`
+	Env             map[string]string `yaml:"env" json:"env"`
+}
+
+// locateManifest looks up the first known manifest filename relative to
+// Papp.Path.
+func locateManifest() (string, error) {
+	for _, name := range manifestFilenames {
+		candidate := filepath.Join(Papp.Path, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no portapp manifest found in %s", Papp.Path)
+}
+
+// FromFile loads Papp fields (ID, Name, Process, Args, WorkingDir,
+// RegsExportImport) from a portapp.yml/portapp.json manifest, so a single
+// generic launcher binary can be driven by a data file instead of a
+// hand-built Papp literal. String fields may reference ${DataPath} and
+// ${Papp.Path}, expanded against the current Papp values.
+func (p *papp) FromFile(path string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read manifest %s: %w", path, err)
+	}
+
+	var m manifest
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return fmt.Errorf("parse manifest %s: %w", path, err)
+		}
+	} else {
+		if err := yaml.Unmarshal(raw, &m); err != nil {
+			return fmt.Errorf("parse manifest %s: %w", path, err)
+		}
+	}
+
+	if m.Process == "" {
+		return fmt.Errorf("manifest %s: process is required", path)
+	}
+
+	p.ID = m.ID
+	p.Name = m.Name
+	p.Process = expandManifestTokens(m.Process)
+	p.WorkingDir = expandManifestTokens(m.WorkingDir)
+
+	p.Args = make([]string, len(m.Args))
+	for i, a := range m.Args {
+		p.Args[i] = expandManifestTokens(a)
+	}
+
+	p.RegsExportImport = make([]RegExportImport, len(m.RegExportImport))
+	for i, ri := range m.RegExportImport {
+		ri.File = expandManifestTokens(ri.File)
+		p.RegsExportImport[i] = ri
+	}
+
+	for key, value := range m.Env {
+		if err := OverrideEnv(key, expandManifestTokens(value)); err != nil {
+			return fmt.Errorf("manifest %s: %w", path, err)
+		}
+	}
+
+	if _, err := os.Stat(p.Process); err != nil {
+		return fmt.Errorf("%w: manifest %s: process %q: %v", ErrProcessMissing, path, p.Process, err)
+	}
+
+	return nil
+}
+
+// Save writes the current Papp fields out as a portapp.yml manifest at path,
+// so third-party tools can generate manifests for FromFile to consume.
+func (p *papp) Save(path string) error {
+	m := manifest{
+		ID:              p.ID,
+		Name:            p.Name,
+		Process:         p.Process,
+		Args:            p.Args,
+		WorkingDir:      p.WorkingDir,
+		RegExportImport: p.RegsExportImport,
+	}
+
+	raw, err := yaml.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	if err := ioutil.WriteFile(path, raw, 0644); err != nil {
+		return fmt.Errorf("write manifest %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// expandManifestTokens replaces ${DataPath} and ${Papp.Path} placeholders
+// inside manifest string fields with their resolved values. ${AppPath} is
+// deliberately not expanded here: Papp.AppPath is set by individual
+// launchers, not by Init, so it isn't populated yet when a manifest loads.
+func expandManifestTokens(s string) string {
+	replacer := strings.NewReplacer(
+		"${DataPath}", Papp.DataPath,
+		"${Papp.Path}", Papp.Path,
+	)
+	return replacer.Replace(s)
+}
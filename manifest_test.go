@@ -0,0 +1,29 @@
+package portableapps
+
+import "testing"
+
+func TestExpandManifestTokens(t *testing.T) {
+	oldPath, oldDataPath := Papp.Path, Papp.DataPath
+	defer func() { Papp.Path, Papp.DataPath = oldPath, oldDataPath }()
+
+	Papp.Path = "/opt/portapps"
+	Papp.DataPath = "/opt/portapps/data"
+
+	got := expandManifestTokens("${Papp.Path}/bin/app --data ${DataPath}")
+	want := "/opt/portapps/bin/app --data /opt/portapps/data"
+	if got != want {
+		t.Errorf("expandManifestTokens() = %q, want %q", got, want)
+	}
+}
+
+func TestExpandManifestTokensLeavesAppPathLiteral(t *testing.T) {
+	oldAppPath := Papp.AppPath
+	defer func() { Papp.AppPath = oldAppPath }()
+	Papp.AppPath = ""
+
+	got := expandManifestTokens("${AppPath}/bin")
+	want := "${AppPath}/bin"
+	if got != want {
+		t.Errorf("expandManifestTokens() = %q, want %q (AppPath is never populated by Init)", got, want)
+	}
+}
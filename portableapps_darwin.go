@@ -0,0 +1,7 @@
+// +build darwin
+
+package portableapps
+
+func init() {
+	persister = posixConfigPersister{}
+}
@@ -0,0 +1,7 @@
+// +build linux
+
+package portableapps
+
+func init() {
+	persister = posixConfigPersister{}
+}
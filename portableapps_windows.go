@@ -0,0 +1,202 @@
+// +build windows
+
+package portableapps
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+func init() {
+	persister = windowsRegistryPersister{}
+}
+
+// PathJoin to join paths
+func PathJoin(elem ...string) string {
+	for i, e := range elem {
+		if e != "" {
+			return strings.Join(elem[i:], `\`)
+		}
+	}
+	return ""
+}
+
+// sysProcAttr hides the child console window when requested and puts it in
+// its own process group, so GenerateConsoleCtrlEvent can target it alone.
+func sysProcAttr(hideWindow bool) *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		HideWindow:    hideWindow,
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+// exitCode reads the exit code off a finished Windows process.
+func exitCode(ps *os.ProcessState) uint32 {
+	return uint32(ps.Sys().(syscall.WaitStatus).ExitCode)
+}
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procSetConsoleCtrlHandler    = kernel32.NewProc("SetConsoleCtrlHandler")
+	procGenerateConsoleCtrlEvent = kernel32.NewProc("GenerateConsoleCtrlEvent")
+	procCreateMutexW             = kernel32.NewProc("CreateMutexW")
+	procReleaseMutex             = kernel32.NewProc("ReleaseMutex")
+	procCloseHandle              = kernel32.NewProc("CloseHandle")
+
+	user32                  = syscall.NewLazyDLL("user32.dll")
+	procEnumWindows         = user32.NewProc("EnumWindows")
+	procIsWindowVisible     = user32.NewProc("IsWindowVisible")
+	procGetWindowTextW      = user32.NewProc("GetWindowTextW")
+	procSetForegroundWindow = user32.NewProc("SetForegroundWindow")
+	procShowWindow          = user32.NewProc("ShowWindow")
+)
+
+const swRestore = 9
+
+const (
+	ctrlBreakEvent    = 1
+	ctrlCloseEvent    = 2
+	ctrlShutdownEvent = 6
+)
+
+// shutdownSignals reports CTRL_CLOSE_EVENT/CTRL_SHUTDOWN_EVENT (e.g. a tray
+// icon's close button, or a service stop) as a signal on the returned
+// channel, since os/signal does not translate those on Windows.
+func shutdownSignals() (<-chan os.Signal, func()) {
+	ch := make(chan os.Signal, 1)
+	handler := syscall.NewCallback(func(ctrlType uint32) uintptr {
+		switch ctrlType {
+		case ctrlCloseEvent, ctrlShutdownEvent:
+			select {
+			case ch <- os.Interrupt:
+			default:
+			}
+			return 1
+		}
+		return 0
+	})
+	procSetConsoleCtrlHandler.Call(handler, 1)
+
+	return ch, func() {
+		procSetConsoleCtrlHandler.Call(handler, 0)
+	}
+}
+
+// signalProcessGroup asks the child's console process group to shut down via
+// CTRL_BREAK_EVENT.
+func signalProcessGroup(proc *os.Process) error {
+	if proc == nil {
+		return nil
+	}
+	r, _, err := procGenerateConsoleCtrlEvent.Call(ctrlBreakEvent, uintptr(proc.Pid))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// killProcessGroup force-kills the child after it ignored a graceful signal.
+func killProcessGroup(proc *os.Process) error {
+	if proc == nil {
+		return nil
+	}
+	return proc.Kill()
+}
+
+// acquireSingleInstance creates a named mutex under `Local\` (or `Global\`
+// when global is true), keyed off name (Papp.ID). If the mutex already
+// exists, another instance is running: its window is foregrounded (matched
+// by Papp.Name) and ErrAlreadyRunning is returned.
+func acquireSingleInstance(name string, global bool) (func(), error) {
+	scope := `Local\`
+	if global {
+		scope = `Global\`
+	}
+
+	namePtr, err := syscall.UTF16PtrFromString(scope + name)
+	if err != nil {
+		return nil, fmt.Errorf("single instance mutex name: %w", err)
+	}
+
+	handle, _, callErr := procCreateMutexW.Call(0, 0, uintptr(unsafe.Pointer(namePtr)))
+	if handle == 0 {
+		return nil, fmt.Errorf("create mutex: %w", callErr)
+	}
+
+	if errno, ok := callErr.(syscall.Errno); ok && errno == syscall.ERROR_ALREADY_EXISTS {
+		procCloseHandle.Call(handle)
+		foregroundWindow(Papp.Name)
+		return nil, ErrAlreadyRunning
+	}
+
+	return func() {
+		procReleaseMutex.Call(handle)
+		procCloseHandle.Call(handle)
+	}, nil
+}
+
+// foregroundWindow brings the first visible window titled title to the
+// front, if any.
+func foregroundWindow(title string) {
+	var target uintptr
+	cb := syscall.NewCallback(func(hwnd uintptr, lparam uintptr) uintptr {
+		if visible, _, _ := procIsWindowVisible.Call(hwnd); visible == 0 {
+			return 1
+		}
+
+		buf := make([]uint16, 256)
+		procGetWindowTextW.Call(hwnd, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+		if syscall.UTF16ToString(buf) == title {
+			target = hwnd
+			return 0
+		}
+		return 1
+	})
+
+	procEnumWindows.Call(cb, 0)
+	if target != 0 {
+		procShowWindow.Call(target, swRestore)
+		procSetForegroundWindow.Call(target)
+	}
+}
+
+// windowsRegistryPersister implements StatePersister on top of the `reg`
+// command-line tool.
+type windowsRegistryPersister struct{}
+
+func (windowsRegistryPersister) Export(reg RegExportImport) error {
+	cmdResult, err := ExecCmd(CmdOptions{
+		Command:    "reg",
+		Args:       []string{"export", reg.Key, reg.File, "/y", fmt.Sprintf("/reg:%s", reg.Arch)},
+		HideWindow: true,
+	})
+	if err != nil {
+		if len(cmdResult.Stderr) > 0 {
+			Log.Errorf("%s", cmdResult.Stderr)
+		}
+		return fmt.Errorf("export registry key '%s': %w", reg.Key, err)
+	}
+	return nil
+}
+
+func (windowsRegistryPersister) Import(reg RegExportImport) error {
+	if _, err := os.Stat(reg.File); err != nil {
+		return nil
+	}
+
+	cmdResult, err := ExecCmd(CmdOptions{
+		Command:    "reg",
+		Args:       []string{"import", reg.File, fmt.Sprintf("/reg:%s", reg.Arch)},
+		HideWindow: true,
+	})
+	if err != nil {
+		if len(cmdResult.Stderr) > 0 {
+			Log.Errorf("%s", cmdResult.Stderr)
+		}
+		return fmt.Errorf("import registry file '%s': %w", reg.File, err)
+	}
+	return nil
+}
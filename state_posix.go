@@ -0,0 +1,134 @@
+// +build linux darwin
+
+package portableapps
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// shutdownSignals has nothing to add to Launch's os/signal channel on POSIX;
+// SIGTERM/SIGINT are already handled via signal.Notify.
+func shutdownSignals() (<-chan os.Signal, func()) {
+	return make(chan os.Signal), func() {}
+}
+
+// signalProcessGroup asks the child's process group (see sysProcAttr's
+// Setsid) to terminate gracefully.
+func signalProcessGroup(proc *os.Process) error {
+	if proc == nil {
+		return nil
+	}
+	return syscall.Kill(-proc.Pid, syscall.SIGTERM)
+}
+
+// killProcessGroup force-kills the child's process group after it ignored a
+// graceful signal.
+func killProcessGroup(proc *os.Process) error {
+	if proc == nil {
+		return nil
+	}
+	return syscall.Kill(-proc.Pid, syscall.SIGKILL)
+}
+
+// acquireSingleInstance guards against concurrent launches with an
+// flock'ed file under Papp.DataPath; global has no POSIX equivalent and is
+// ignored.
+func acquireSingleInstance(name string, global bool) (func(), error) {
+	if err := os.MkdirAll(Papp.DataPath, 0755); err != nil {
+		return nil, fmt.Errorf("single instance lock dir: %w", err)
+	}
+
+	lockPath := filepath.Join(Papp.DataPath, name+".lock")
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file %s: %w", lockPath, err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, ErrAlreadyRunning
+		}
+		return nil, fmt.Errorf("flock %s: %w", lockPath, err)
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// PathJoin to join paths
+func PathJoin(elem ...string) string {
+	return filepath.Join(elem...)
+}
+
+// sysProcAttr runs the child in its own session, which is the closest POSIX
+// equivalent to Windows' hidden-window flag for a detached process.
+func sysProcAttr(hideWindow bool) *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// exitCode reads the exit status off a finished POSIX process.
+func exitCode(ps *os.ProcessState) uint32 {
+	return uint32(ps.Sys().(syscall.WaitStatus).ExitStatus())
+}
+
+// posixConfigPersister implements StatePersister on POSIX systems by
+// dumping/restoring the app's config directory under $XDG_CONFIG_HOME,
+// standing in for a Windows registry snapshot.
+type posixConfigPersister struct{}
+
+func (p posixConfigPersister) configDir(key string) string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		base = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(base, key)
+}
+
+func (p posixConfigPersister) Export(reg RegExportImport) error {
+	return copyDir(p.configDir(reg.Key), reg.File)
+}
+
+func (p posixConfigPersister) Import(reg RegExportImport) error {
+	if _, err := os.Stat(reg.File); err != nil {
+		return nil
+	}
+	return copyDir(reg.File, p.configDir(reg.Key))
+}
+
+// copyDir recursively copies src onto dst, creating directories as needed.
+// A missing src (nothing persisted yet, e.g. on a fresh install) is not an
+// error.
+func copyDir(src, dst string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode())
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, data, info.Mode())
+	})
+}